@@ -0,0 +1,138 @@
+/*
+ bspline.go
+
+ A cubic B-spline basis, provided as a ready-to-use DBasisFunction for
+ FunctionalRegression.
+
+ author: Timothy A. Mann
+ date: September 15, 2014
+*/
+
+package goml
+
+import "fmt"
+
+/*
+cubicBSplineDegree is the polynomial degree of the basis functions produced
+by CubicBSplineBasis.
+*/
+const cubicBSplineDegree = 3
+
+/*
+CubicBSplineBasis is a DBasisFunction implementation backed by a clamped,
+uniformly-knotted cubic B-spline basis spanning a fixed time domain.
+*/
+type CubicBSplineBasis struct {
+	knots []float64
+}
+
+/*
+NewCubicBSplineBasis constructs a cubic B-spline basis of numBasis functions
+spanning [tmin, tmax] with interior knots spaced uniformly.
+
+Input
+=====
+tmin : the start of the domain
+tmax : the end of the domain
+numBasis : the number of basis functions (must be >= 4 for a cubic basis)
+
+Returns
+=======
+a pointer to a new CubicBSplineBasis or an error
+*/
+func NewCubicBSplineBasis(tmin, tmax float64, numBasis int) (*CubicBSplineBasis, error) {
+	p := cubicBSplineDegree
+	if numBasis < p+1 {
+		return nil, fmt.Errorf("numBasis must be at least %d for a cubic B-spline basis.", p+1)
+	}
+	if tmax <= tmin {
+		return nil, fmt.Errorf("tmax must be greater than tmin.")
+	}
+
+	numKnots := numBasis + p + 1
+	numInterior := numBasis - p - 1
+	knots := make([]float64, numKnots)
+	for i := 0; i <= p; i++ {
+		knots[i] = tmin
+		knots[numKnots-1-i] = tmax
+	}
+	if numInterior > 0 {
+		step := (tmax - tmin) / float64(numInterior+1)
+		for i := 0; i < numInterior; i++ {
+			knots[p+1+i] = tmin + step*float64(i+1)
+		}
+	}
+
+	return &CubicBSplineBasis{knots: knots}, nil
+}
+
+/*
+Eval computes the value of basis function k at t.
+*/
+func (self *CubicBSplineBasis) Eval(k int, t float64) float64 {
+	return bsplineBasis(k, cubicBSplineDegree, t, self.knots)
+}
+
+/*
+Deriv2 computes the second derivative of basis function k at t.
+*/
+func (self *CubicBSplineBasis) Deriv2(k int, t float64) float64 {
+	return bsplineDeriv(k, cubicBSplineDegree, 2, t, self.knots)
+}
+
+/*
+bsplineBasis evaluates the i-th B-spline basis function of degree p defined
+by knots at t using the Cox-de Boor recursion.
+*/
+func bsplineBasis(i, p int, t float64, knots []float64) float64 {
+	if p == 0 {
+		if knots[i] <= t && t < knots[i+1] {
+			return 1
+		}
+		// Treat the basis as right-closed at the very end of the domain so
+		// that Eval(k, tmax) is well defined. The last non-empty knot span
+		// takes the endpoint, since the clamped spans after it are empty.
+		if t == knots[len(knots)-1] {
+			last := len(knots) - 2
+			for last > 0 && knots[last] == knots[last+1] {
+				last--
+			}
+			if i == last {
+				return 1
+			}
+		}
+		return 0
+	}
+
+	left, right := 0.0, 0.0
+	if denom := knots[i+p] - knots[i]; denom != 0 {
+		left = (t - knots[i]) / denom * bsplineBasis(i, p-1, t, knots)
+	}
+	if denom := knots[i+p+1] - knots[i+1]; denom != 0 {
+		right = (knots[i+p+1] - t) / denom * bsplineBasis(i+1, p-1, t, knots)
+	}
+	return left + right
+}
+
+/*
+bsplineDeriv evaluates the n-th derivative of the i-th B-spline basis
+function of degree p defined by knots at t, using the standard recursive
+derivative formula for B-splines.
+*/
+func bsplineDeriv(i, p, n int, t float64, knots []float64) float64 {
+	if n == 0 {
+		return bsplineBasis(i, p, t, knots)
+	}
+	if p == 0 {
+		return 0
+	}
+
+	left, right := 0.0, 0.0
+	if denom := knots[i+p] - knots[i]; denom != 0 {
+		left = float64(p) / denom * bsplineDeriv(i, p-1, n-1, t, knots)
+	}
+	if denom := knots[i+p+1] - knots[i+1]; denom != 0 {
+		right = float64(p) / denom * bsplineDeriv(i+1, p-1, n-1, t, knots)
+	}
+	return left - right
+}
@@ -9,10 +9,11 @@
 package goml
 
 import (
-	mat "github.com/skelterjohn/go.matrix"
 	"math"
 	"math/rand"
 	"testing"
+
+	"github.com/gonum/matrix/mat64"
 )
 
 const (
@@ -40,8 +41,8 @@ the MSE of the fa on samples from the linear function
 */
 func LinearFitAndReturnMSE(fa FunctionApproximator, t *testing.T) float64 {
 	n := 100
-	x := mat.Zeros(n, 1)
-	y := mat.Zeros(n, 1)
+	x := mat64.NewDense(n, 1, nil)
+	y := mat64.NewDense(n, 1, nil)
 	for i := 0; i < n; i++ {
 		fi := float64(i)
 		fn := float64(n)
@@ -61,21 +62,21 @@ func LinearFitAndReturnMSE(fa FunctionApproximator, t *testing.T) float64 {
 		t.Error(err)
 	}
 
-	sqErrM := 0.0
-	diffM, err := y.Minus(yhatM)
-	if err != nil {
-		t.Error(err)
-	}
+	var diffM mat64.Dense
+	diffM.Sub(y, yhatM)
 
+	sqErrM := 0.0
 	sqErr := 0.0
+	row := mat64.NewDense(1, 1, nil)
 	for i := 0; i < n; i++ {
-		sqErrM += diffM.Get(i, 0) * diffM.Get(i, 0)
+		sqErrM += diffM.At(i, 0) * diffM.At(i, 0)
 
-		v, err := fa.Predict(x.GetRowVector(i))
+		row.Set(0, 0, x.At(i, 0))
+		v, err := fa.Predict(row)
 		if err != nil {
 			t.Error(err)
 		}
-		diff := y.Get(i, 0) - v
+		diff := y.At(i, 0) - v
 		sqErr += diff * diff
 	}
 
@@ -121,3 +122,262 @@ func TestSGD(t *testing.T) {
 		t.Error("MSE (", mse, ") is too large (w/nil activation function).")
 	}
 }
+
+/*
+TestSGDNonlinearActivation checks that Fit actually trains against afunc's
+output (rather than the unactivated linear model) by fitting a target that is
+substantially nonlinear over the training range: y = tanh(3*x).
+*/
+func TestSGDNonlinearActivation(t *testing.T) {
+	n := 200
+	x := mat64.NewDense(n, 1, nil)
+	y := mat64.NewDense(n, 1, nil)
+	for i := 0; i < n; i++ {
+		fx := -1.0 + 2.0*float64(i)/float64(n-1)
+		fy := math.Tanh(3*fx) + rand.NormFloat64()*LINEAR_NOISE
+		x.Set(i, 0, fx)
+		y.Set(i, 0, fy)
+	}
+
+	sgd, err := NewSGD(L2_PENALTY, 0.001, 2000, 0.5, new(Tanh))
+	if err != nil {
+		t.Fatal("Error while constructing SGD instance.", err)
+	}
+	if err := sgd.Fit(x, y); err != nil {
+		t.Fatal("Error while fitting SGD instance.", err)
+	}
+
+	yhat, err := sgd.PredictM(x)
+	if err != nil {
+		t.Fatal("Error while predicting.", err)
+	}
+	var diff mat64.Dense
+	diff.Sub(y, yhat)
+	sqErr := 0.0
+	for i := 0; i < n; i++ {
+		sqErr += diff.At(i, 0) * diff.At(i, 0)
+	}
+	mse := sqErr / float64(n)
+	t.Log("mse:", mse)
+	if mse > 0.05 {
+		t.Error("MSE (", mse, ") is too large; Fit should train against afunc's output, not the raw linear model.")
+	}
+}
+
+/*
+TestSGDOptimizers checks that SGD converges on a linear function using each of
+the adaptive/decaying Optimizers, not just the default constant-rate gradient
+descent exercised by TestSGD.
+*/
+func TestSGDOptimizers(t *testing.T) {
+	lambda := 0.01
+	numIterations := 2000
+	optimizers := map[string]Optimizer{
+		"InverseTime": &InverseTimeOptimizer{Rate: 0.5, Decay: 0.001},
+		"AdaGrad":     &AdaGradOptimizer{Rate: 0.5, Epsilon: 1e-8},
+		"RMSProp":     &RMSPropOptimizer{Rate: 0.05, Decay: 0.9, Epsilon: 1e-8},
+		"Adam":        &AdamOptimizer{Rate: 0.05, Beta1: 0.9, Beta2: 0.999, Epsilon: 1e-8},
+	}
+	for name, opt := range optimizers {
+		sgd, err := NewSGD(L2_PENALTY, lambda, numIterations, 0.1, nil)
+		if err != nil {
+			t.Fatal("Error while constructing SGD instance.", err)
+		}
+		sgd.Optimizer = opt
+		mse := LinearFitAndReturnMSE(sgd, t)
+		if mse > LINEAR_NOISE {
+			t.Error(name, ": MSE (", mse, ") is too large.")
+		}
+	}
+}
+
+/*
+TestSGDNewCopy checks that NewCopy carries over the Optimizer set on the
+original instance, not just the scalar hyperparameters.
+*/
+func TestSGDNewCopy(t *testing.T) {
+	sgd, err := NewSGD(L2_PENALTY, 0.01, 100, 0.1, nil)
+	if err != nil {
+		t.Fatal("Error while constructing SGD instance.", err)
+	}
+	sgd.Optimizer = &AdamOptimizer{Rate: 0.05, Beta1: 0.9, Beta2: 0.999, Epsilon: 1e-8}
+
+	cp, err := sgd.NewCopy()
+	if err != nil {
+		t.Fatal("Error while copying SGD instance.", err)
+	}
+	if cp.Optimizer != sgd.Optimizer {
+		t.Error("NewCopy did not carry over the Optimizer set on the original instance.")
+	}
+}
+
+/*
+TestLBFGS creates an LBFGS instance and tests whether it can fit a linear
+function in far fewer iterations than SGD needs.
+*/
+func TestLBFGS(t *testing.T) {
+	lambda := 0.01
+	numIterations := 50
+	m := 8
+	afunc := new(Tanh)
+	lbfgs, err := NewLBFGS(L2_PENALTY, lambda, numIterations, m, afunc)
+	if err != nil {
+		t.Error("Error while constructing LBFGS instance with Tanh activation function.", err)
+	}
+	mse := LinearFitAndReturnMSE(lbfgs, t)
+	t.Log(lbfgs.Weights())
+	if mse > LINEAR_NOISE {
+		t.Error("MSE (", mse, ") is too large (w/Tanh activation function).")
+	}
+
+	lbfgs, err = NewLBFGS(L2_PENALTY, lambda, numIterations, m, nil)
+	if err != nil {
+		t.Error("Error while constructing LBFGS instance without activation function.", err)
+	}
+	mse = LinearFitAndReturnMSE(lbfgs, t)
+	t.Log(lbfgs.Weights())
+	if mse > LINEAR_NOISE {
+		t.Error("MSE (", mse, ") is too large (w/nil activation function).")
+	}
+}
+
+/*
+TestLBFGSNonlinearActivation checks that evaluate actually trains against
+afunc's output (rather than the unactivated linear model) by fitting a target
+that is substantially nonlinear over the training range: y = tanh(3*x).
+*/
+func TestLBFGSNonlinearActivation(t *testing.T) {
+	n := 200
+	x := mat64.NewDense(n, 1, nil)
+	y := mat64.NewDense(n, 1, nil)
+	for i := 0; i < n; i++ {
+		fx := -1.0 + 2.0*float64(i)/float64(n-1)
+		fy := math.Tanh(3*fx) + rand.NormFloat64()*LINEAR_NOISE
+		x.Set(i, 0, fx)
+		y.Set(i, 0, fy)
+	}
+
+	lbfgs, err := NewLBFGS(L2_PENALTY, 0.001, 50, 8, new(Tanh))
+	if err != nil {
+		t.Fatal("Error while constructing LBFGS instance.", err)
+	}
+	if err := lbfgs.Fit(x, y); err != nil {
+		t.Fatal("Error while fitting LBFGS instance.", err)
+	}
+
+	yhat, err := lbfgs.PredictM(x)
+	if err != nil {
+		t.Fatal("Error while predicting.", err)
+	}
+	var diff mat64.Dense
+	diff.Sub(y, yhat)
+	sqErr := 0.0
+	for i := 0; i < n; i++ {
+		sqErr += diff.At(i, 0) * diff.At(i, 0)
+	}
+	mse := sqErr / float64(n)
+	t.Log("mse:", mse)
+	if mse > 0.05 {
+		t.Error("MSE (", mse, ") is too large; evaluate should train against afunc's output, not the raw linear model.")
+	}
+}
+
+/*
+TestRidge creates a Ridge instance and tests whether it can fit a linear
+function in closed form.
+*/
+func TestRidge(t *testing.T) {
+	ridge, err := NewRidge(0.001)
+	if err != nil {
+		t.Error("Error while constructing Ridge instance.", err)
+	}
+	mse := LinearFitAndReturnMSE(ridge, t)
+	t.Log(ridge.Fitted())
+	if mse > LINEAR_NOISE {
+		t.Error("MSE (", mse, ") is too large.")
+	}
+}
+
+/*
+TestNetwork creates a small two-layer Network and tests whether it can fit a
+linear function.
+*/
+func TestNetwork(t *testing.T) {
+	net := NewNetwork(NewLayer(1, 4, new(Tanh)), NewLayer(4, 1, nil))
+	mse := LinearFitAndReturnMSE(net, t)
+	if mse > LINEAR_NOISE {
+		t.Error("MSE (", mse, ") is too large.")
+	}
+}
+
+/*
+TestNetworkCustomOptimizer checks that a Layer's caller-supplied Optimizer
+survives Train (rather than being overwritten with a GDOptimizer) and that
+the network still fits a linear function with it.
+*/
+func TestNetworkCustomOptimizer(t *testing.T) {
+	layer1 := NewLayer(1, 4, new(Tanh))
+	layer2 := NewLayer(4, 1, nil)
+	layer1.WOpt = &MomentumOptimizer{Momentum: 0.9}
+	layer1.BOpt = &MomentumOptimizer{Momentum: 0.9}
+	layer2.WOpt = &MomentumOptimizer{Momentum: 0.9}
+	layer2.BOpt = &MomentumOptimizer{Momentum: 0.9}
+	net := NewNetwork(layer1, layer2)
+
+	mse := LinearFitAndReturnMSE(net, t)
+	if mse > LINEAR_NOISE {
+		t.Error("MSE (", mse, ") is too large.")
+	}
+
+	for _, layer := range net.Layers {
+		if _, ok := layer.WOpt.(*MomentumOptimizer); !ok {
+			t.Error("layer.WOpt was overwritten by Train; expected it to remain a *MomentumOptimizer.")
+		}
+		if _, ok := layer.BOpt.(*MomentumOptimizer); !ok {
+			t.Error("layer.BOpt was overwritten by Train; expected it to remain a *MomentumOptimizer.")
+		}
+	}
+}
+
+/*
+TestGP creates a GP instance with a squared-exponential kernel and tests
+whether it can fit a linear function and produce a sensible posterior
+covariance.
+*/
+func TestGP(t *testing.T) {
+	kernel := SquaredExponentialKernel{Lengthscale: 0.2, Variance: 1.0}
+	gp, err := NewGP(kernel, 0.01)
+	if err != nil {
+		t.Fatal("Error while constructing GP instance.", err)
+	}
+	mse := LinearFitAndReturnMSE(gp, t)
+	if mse > LINEAR_NOISE {
+		t.Error("MSE (", mse, ") is too large.")
+	}
+
+	xstar := mat64.NewDense(1, 1, []float64{0.5})
+	cov, err := gp.Cov(xstar)
+	if err != nil {
+		t.Fatal("Error while computing posterior covariance.", err)
+	}
+	if cov.At(0, 0) < 0 {
+		t.Error("Posterior variance (", cov.At(0, 0), ") should not be negative.")
+	}
+}
+
+/*
+TestMaternKernel checks that MaternKernel returns its variance at zero
+distance and decays as points move apart.
+*/
+func TestMaternKernel(t *testing.T) {
+	kernel := MaternKernel{Lengthscale: 1.0, Variance: 2.0, Nu: 2.5}
+	a := []float64{0.0}
+	if v := kernel.Distance(a, a); math.Abs(v-kernel.Variance) > 1e-9 {
+		t.Error("Distance(a, a) (", v, ") should equal Variance (", kernel.Variance, ").")
+	}
+	near := kernel.Distance(a, []float64{0.1})
+	far := kernel.Distance(a, []float64{5.0})
+	if far >= near {
+		t.Error("Covariance should decay with distance.")
+	}
+}
@@ -0,0 +1,235 @@
+/*
+ functional.go
+
+ Functional regression: fitting a scalar response from functional covariates
+ sampled on a common time grid (sometimes called function-to-scalar, or F2S,
+ regression).
+
+ author: Timothy A. Mann
+ date: September 15, 2014
+*/
+
+package goml
+
+import (
+	"fmt"
+
+	"github.com/gonum/matrix/mat64"
+)
+
+/*
+DBasisFunction is a basis function used to expand a functional coefficient
+b(t) = sum_k c_k*phi_k(t). Deriv2 is required so that FunctionalRegression can
+penalize the roughness of the fitted coefficient function.
+*/
+type DBasisFunction interface {
+	/*
+		Eval returns the value of basis function k at t.
+	*/
+	Eval(k int, t float64) float64
+
+	/*
+		Deriv2 returns the second derivative of basis function k at t.
+	*/
+	Deriv2(k int, t float64) float64
+}
+
+/*
+FunctionalRegression fits a scalar response y from functional covariates x(t)
+sampled on a common grid t. The coefficient function b(t) is expanded in a
+basis of K functions and fit by penalized least squares, trading off fit
+against the roughness (integrated squared second derivative) of b.
+*/
+type FunctionalRegression struct {
+	/*
+		The roughness penalty parameter.
+	*/
+	Lambda float64
+	/*
+		The basis used to expand the coefficient function b(t).
+	*/
+	Basis DBasisFunction
+	/*
+		The number of basis functions.
+	*/
+	K int
+
+	t    []float64
+	coef *mat64.Dense
+}
+
+/*
+NewFunctionalRegression constructs a new FunctionalRegression instance.
+
+Input
+=====
+lambda : the roughness penalty parameter (should >= 0)
+basis : the basis used to expand the coefficient function b(t)
+k : the number of basis functions
+
+Returns
+=======
+a pointer to a new (untrained) FunctionalRegression instance or an error
+*/
+func NewFunctionalRegression(lambda float64, basis DBasisFunction, k int) (*FunctionalRegression, error) {
+	if lambda < 0.0 {
+		return nil, fmt.Errorf("Regularization parameter cannot be negative.")
+	}
+	if basis == nil {
+		return nil, fmt.Errorf("basis cannot be nil.")
+	}
+	if k < 1 {
+		return nil, fmt.Errorf("k must be positive.")
+	}
+	self := new(FunctionalRegression)
+	self.Lambda = lambda
+	self.Basis = basis
+	self.K = k
+	return self, nil
+}
+
+/*
+Fit fits this FunctionalRegression to the training data.
+
+Input
+=====
+x : a matrix where each row is a functional covariate sampled at the points in t
+y : a column vector of scalar responses, one per row of x
+t : the common time grid that each row of x was sampled on
+
+Returns
+=======
+an error if the fitting process fails
+*/
+func (self *FunctionalRegression) Fit(x mat64.Matrix, y mat64.Matrix, t []float64) error {
+	if rows(x) != rows(y) {
+		return fmt.Errorf("The number of rows in x (%d) does not match the number of rows in y (%d).", rows(x), rows(y))
+	}
+	if cols(y) != 1 {
+		return fmt.Errorf("y must be a column vector.")
+	}
+	if cols(x) != len(t) {
+		return fmt.Errorf("x has %d columns. Expected one column per point in t (%d).", cols(x), len(t))
+	}
+
+	n := rows(x)
+
+	// Design matrix: Phi[i,k] = integral of x_i(s)*phi_k(s) ds
+	phi := mat64.NewDense(n, self.K, nil)
+	row := make([]float64, len(t))
+	for i := 0; i < n; i++ {
+		for c := range row {
+			row[c] = x.At(i, c)
+		}
+		for k := 0; k < self.K; k++ {
+			phi.Set(i, k, trapzBasisInnerProduct(row, t, self.Basis, k))
+		}
+	}
+
+	// Roughness penalty: R[k,l] = integral of phi_k''(s)*phi_l''(s) ds
+	r := mat64.NewDense(self.K, self.K, nil)
+	for k := 0; k < self.K; k++ {
+		for l := k; l < self.K; l++ {
+			v := trapzDeriv2Product(t, self.Basis, k, l)
+			r.Set(k, l, v)
+			r.Set(l, k, v)
+		}
+	}
+
+	// Solve (Phi^T*Phi + lambda*R)*c = Phi^T*y via Cholesky.
+	var ptp, rScaled, a mat64.Dense
+	ptp.Mul(phi.T(), phi)
+	rScaled.Scale(self.Lambda, r)
+	a.Add(&ptp, &rScaled)
+
+	sym := mat64.NewSymDense(self.K, nil)
+	for i := 0; i < self.K; i++ {
+		for j := i; j < self.K; j++ {
+			sym.SetSym(i, j, a.At(i, j))
+		}
+	}
+	var chol mat64.Cholesky
+	if !chol.Factorize(sym) {
+		return fmt.Errorf("Failed to factorize Phi^T*Phi + lambda*R. Try increasing lambda or reducing K.")
+	}
+
+	var pty mat64.Dense
+	pty.Mul(phi.T(), y)
+
+	var coef mat64.Dense
+	if err := coef.SolveCholesky(&chol, &pty); err != nil {
+		return fmt.Errorf("Error while solving for basis coefficients. %v", err)
+	}
+
+	self.t = t
+	self.coef = &coef
+	return nil
+}
+
+/*
+Predict reconstructs b(t) = sum_k c_k*phi_k(t) from the fitted coefficients
+and returns the integral of b(t)*x(t) over the grid t passed to Fit.
+
+Input
+=====
+x : a functional covariate sampled at the points in the grid passed to Fit
+
+Returns
+=======
+the predicted scalar response, or an error
+*/
+func (self *FunctionalRegression) Predict(x []float64) (float64, error) {
+	if self.coef == nil {
+		return 0, fmt.Errorf("Cannot predict before running the Fit method.")
+	}
+	if len(x) != len(self.t) {
+		return 0, fmt.Errorf("x has %d points. Expected %d.", len(x), len(self.t))
+	}
+
+	yhat := 0.0
+	for k := 0; k < self.K; k++ {
+		yhat += self.coef.At(k, 0) * trapzBasisInnerProduct(x, self.t, self.Basis, k)
+	}
+	return yhat, nil
+}
+
+/*
+Coef returns the fitted basis coefficients. If Fit() has not been executed
+yet, then the behavior of this method is undefined.
+
+Returns
+=======
+a column vector of K basis coefficients
+*/
+func (self *FunctionalRegression) Coef() *mat64.Dense {
+	return self.coef
+}
+
+/*
+trapzBasisInnerProduct approximates the integral of f(s)*basis.Eval(k, s) ds
+over the grid t using the trapezoidal rule.
+*/
+func trapzBasisInnerProduct(f []float64, t []float64, basis DBasisFunction, k int) float64 {
+	sum := 0.0
+	for i := 0; i < len(t)-1; i++ {
+		a := f[i] * basis.Eval(k, t[i])
+		b := f[i+1] * basis.Eval(k, t[i+1])
+		sum += (t[i+1] - t[i]) * (a + b) / 2
+	}
+	return sum
+}
+
+/*
+trapzDeriv2Product approximates the integral of
+basis.Deriv2(k, s)*basis.Deriv2(l, s) ds over the grid t using the
+trapezoidal rule.
+*/
+func trapzDeriv2Product(t []float64, basis DBasisFunction, k, l int) float64 {
+	sum := 0.0
+	for i := 0; i < len(t)-1; i++ {
+		a := basis.Deriv2(k, t[i]) * basis.Deriv2(l, t[i])
+		b := basis.Deriv2(k, t[i+1]) * basis.Deriv2(l, t[i+1])
+		sum += (t[i+1] - t[i]) * (a + b) / 2
+	}
+	return sum
+}
@@ -0,0 +1,80 @@
+/*
+ functional_test.go
+
+ Tests FunctionalRegression.
+
+ author: Timothy A. Mann
+ date: September 15, 2014
+*/
+package goml
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/gonum/matrix/mat64"
+)
+
+/*
+TestFunctionalRegression generates functional covariates x(t) with an
+independent standard normal value at each grid point and fits
+y = integral of x(t)*t dt, then checks that FunctionalRegression recovers
+this relationship.
+*/
+func TestFunctionalRegression(t *testing.T) {
+	nT := 20
+	grid := make([]float64, nT)
+	for i := range grid {
+		grid[i] = float64(i) / float64(nT-1)
+	}
+
+	n := 200
+	x := mat64.NewDense(n, nT, nil)
+	y := mat64.NewDense(n, 1, nil)
+	for i := 0; i < n; i++ {
+		yi := 0.0
+		prev := 0.0
+		for j, s := range grid {
+			xv := rand.NormFloat64()
+			x.Set(i, j, xv)
+			cur := xv * s
+			if j > 0 {
+				yi += (grid[j] - grid[j-1]) * (cur + prev) / 2
+			}
+			prev = cur
+		}
+		y.Set(i, 0, yi+rand.NormFloat64()*0.01)
+	}
+
+	basis, err := NewCubicBSplineBasis(0, 1, 8)
+	if err != nil {
+		t.Fatal("Error while constructing CubicBSplineBasis.", err)
+	}
+	fr, err := NewFunctionalRegression(0.01, basis, 8)
+	if err != nil {
+		t.Fatal("Error while constructing FunctionalRegression.", err)
+	}
+	if err := fr.Fit(x, y, grid); err != nil {
+		t.Fatal("Error while fitting FunctionalRegression.", err)
+	}
+
+	sqErr := 0.0
+	row := make([]float64, nT)
+	for i := 0; i < n; i++ {
+		for j := range row {
+			row[j] = x.At(i, j)
+		}
+		v, err := fr.Predict(row)
+		if err != nil {
+			t.Error(err)
+		}
+		diff := y.At(i, 0) - v
+		sqErr += diff * diff
+	}
+
+	mse := sqErr / float64(n)
+	t.Log("mse:", mse)
+	if mse > 0.05 {
+		t.Error("MSE (", mse, ") is too large.")
+	}
+}
@@ -0,0 +1,275 @@
+/*
+ gp.go
+
+ Gaussian process regression: a nonparametric Bayesian regressor that
+ produces a predictive mean alongside a principled uncertainty estimate.
+
+ author: Timothy A. Mann
+ date: September 29, 2014
+*/
+
+package goml
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/gonum/matrix/mat64"
+)
+
+/*
+Kernel measures the covariance between two input vectors. A Kernel should be
+symmetric (Distance(a, b) == Distance(b, a)) and produce a positive
+semi-definite covariance matrix over any finite set of inputs.
+*/
+type Kernel interface {
+	/*
+		Distance returns the covariance between a and b under this kernel.
+	*/
+	Distance(a, b []float64) float64
+}
+
+/*
+SquaredExponentialKernel is the classic smooth (infinitely differentiable)
+covariance function k(a,b) = Variance*exp(-||a-b||^2 / (2*Lengthscale^2)).
+*/
+type SquaredExponentialKernel struct {
+	Lengthscale float64
+	Variance    float64
+}
+
+func (self SquaredExponentialKernel) Distance(a, b []float64) float64 {
+	sqDist := sqEuclidean(a, b)
+	return self.Variance * math.Exp(-sqDist/(2*self.Lengthscale*self.Lengthscale))
+}
+
+/*
+MaternKernel is the Matern covariance function with smoothness parameter Nu.
+Closed forms are used for the common cases Nu == 1.5 and Nu == 2.5; any other
+Nu falls back to the Nu == 1.5 form.
+*/
+type MaternKernel struct {
+	Lengthscale float64
+	Variance    float64
+	Nu          float64
+}
+
+func (self MaternKernel) Distance(a, b []float64) float64 {
+	r := math.Sqrt(sqEuclidean(a, b))
+	switch self.Nu {
+	case 2.5:
+		s := math.Sqrt(5) * r / self.Lengthscale
+		return self.Variance * (1 + s + s*s/3) * math.Exp(-s)
+	default:
+		s := math.Sqrt(3) * r / self.Lengthscale
+		return self.Variance * (1 + s) * math.Exp(-s)
+	}
+}
+
+/*
+sqEuclidean returns the squared Euclidean distance between a and b.
+*/
+func sqEuclidean(a, b []float64) float64 {
+	sum := 0.0
+	for i := range a {
+		d := a[i] - b[i]
+		sum += d * d
+	}
+	return sum
+}
+
+/*
+GP is a Gaussian process regressor. It satisfies FunctionApproximator by
+fitting the posterior mean of the process: Fit Cholesky-factorizes the
+kernel (covariance) matrix of the training inputs once and caches
+alpha = K^-1*y, so that Predict only needs to evaluate the kernel against the
+training inputs and take a dot product with alpha.
+*/
+type GP struct {
+	/*
+		The covariance function shared by every pair of inputs.
+	*/
+	Kernel Kernel
+	/*
+		The variance of observation noise, added to the diagonal of the
+		kernel matrix.
+	*/
+	Sigma2 float64
+
+	inputDims int
+	x         [][]float64
+	chol      *mat64.Cholesky
+	alpha     *mat64.Dense
+}
+
+/*
+NewGP constructs a new GP instance.
+
+Input
+=====
+kernel : the covariance function to use
+sigma2 : the observation noise variance (should be >= 0)
+
+Returns
+=======
+a pointer to a new (untrained) GP instance or an error
+*/
+func NewGP(kernel Kernel, sigma2 float64) (*GP, error) {
+	if kernel == nil {
+		return nil, fmt.Errorf("kernel cannot be nil.")
+	}
+	if sigma2 < 0.0 {
+		return nil, fmt.Errorf("sigma2 cannot be negative.")
+	}
+	self := new(GP)
+	self.Kernel = kernel
+	self.Sigma2 = sigma2
+	return self, nil
+}
+
+func (self *GP) Fit(x mat64.Matrix, y mat64.Matrix) error {
+	if rows(x) != rows(y) {
+		return fmt.Errorf("The number of rows in x (%d) does not match the number of rows in y (%d).", rows(x), rows(y))
+	}
+	if cols(y) != 1 {
+		return fmt.Errorf("y must be a column vector.")
+	}
+
+	n := rows(x)
+	self.inputDims = cols(x)
+	self.x = matrixToRows(x)
+
+	k := mat64.NewSymDense(n, nil)
+	for i := 0; i < n; i++ {
+		for j := i; j < n; j++ {
+			v := self.Kernel.Distance(self.x[i], self.x[j])
+			if i == j {
+				v += self.Sigma2
+			}
+			k.SetSym(i, j, v)
+		}
+	}
+
+	var chol mat64.Cholesky
+	if !chol.Factorize(k) {
+		return fmt.Errorf("Failed to factorize the kernel matrix. Try increasing Sigma2.")
+	}
+	self.chol = &chol
+
+	var alpha mat64.Dense
+	if err := alpha.SolveCholesky(&chol, y); err != nil {
+		return fmt.Errorf("Error while solving for alpha. %v", err)
+	}
+	self.alpha = &alpha
+
+	return nil
+}
+
+/*
+kStar returns the column vector of covariances between xstar and every
+training input.
+*/
+func (self *GP) kStar(xstar []float64) *mat64.Dense {
+	n := len(self.x)
+	k := mat64.NewDense(n, 1, nil)
+	for i := 0; i < n; i++ {
+		k.Set(i, 0, self.Kernel.Distance(self.x[i], xstar))
+	}
+	return k
+}
+
+func (self *GP) Predict(x mat64.Matrix) (float64, error) {
+	if self.alpha == nil {
+		return 0, fmt.Errorf("Cannot predict before running the Fit method.")
+	}
+	if cols(x) != self.inputDims {
+		return 0, fmt.Errorf("x has %d columns. Expected %d.", cols(x), self.inputDims)
+	}
+	kstar := self.kStar(matrixToRows(x)[0])
+	var pred mat64.Dense
+	pred.Mul(kstar.T(), self.alpha)
+	return pred.At(0, 0), nil
+}
+
+func (self *GP) PredictM(x mat64.Matrix) (mat64.Matrix, error) {
+	if self.alpha == nil {
+		return nil, fmt.Errorf("Cannot predict before running the Fit method.")
+	}
+	if cols(x) != self.inputDims {
+		return nil, fmt.Errorf("x has %d columns. Expected %d.", cols(x), self.inputDims)
+	}
+	xs := matrixToRows(x)
+	yhat := mat64.NewDense(len(xs), 1, nil)
+	for i, xstar := range xs {
+		kstar := self.kStar(xstar)
+		var pred mat64.Dense
+		pred.Mul(kstar.T(), self.alpha)
+		yhat.Set(i, 0, pred.At(0, 0))
+	}
+	return yhat, nil
+}
+
+func (self *GP) InputDims() int {
+	return self.inputDims
+}
+
+/*
+Cov returns the posterior covariance K(x*,x*) - k*^T*K^-1*k* of the process
+at the rows of x, given the training data passed to Fit.
+
+Returns
+=======
+an m x m covariance matrix, where m is the number of rows in x, or an error
+*/
+func (self *GP) Cov(x mat64.Matrix) (*mat64.Dense, error) {
+	if self.chol == nil {
+		return nil, fmt.Errorf("Cannot compute the covariance before running the Fit method.")
+	}
+	if cols(x) != self.inputDims {
+		return nil, fmt.Errorf("x has %d columns. Expected %d.", cols(x), self.inputDims)
+	}
+
+	xs := matrixToRows(x)
+	m := len(xs)
+	kss := mat64.NewDense(m, m, nil)
+	for i := 0; i < m; i++ {
+		for j := 0; j < m; j++ {
+			kss.Set(i, j, self.Kernel.Distance(xs[i], xs[j]))
+		}
+	}
+
+	n := len(self.x)
+	kstarAll := mat64.NewDense(n, m, nil)
+	for i := 0; i < n; i++ {
+		for j := 0; j < m; j++ {
+			kstarAll.Set(i, j, self.Kernel.Distance(self.x[i], xs[j]))
+		}
+	}
+
+	var v mat64.Dense
+	if err := v.SolveCholesky(self.chol, kstarAll); err != nil {
+		return nil, fmt.Errorf("Error while solving for the posterior covariance. %v", err)
+	}
+	var reduction mat64.Dense
+	reduction.Mul(kstarAll.T(), &v)
+
+	var cov mat64.Dense
+	cov.Sub(kss, &reduction)
+	return &cov, nil
+}
+
+/*
+matrixToRows copies every row of x into its own []float64.
+*/
+func matrixToRows(x mat64.Matrix) [][]float64 {
+	n := rows(x)
+	d := cols(x)
+	out := make([][]float64, n)
+	for i := 0; i < n; i++ {
+		out[i] = make([]float64, d)
+		for j := 0; j < d; j++ {
+			out[i][j] = x.At(i, j)
+		}
+	}
+	return out
+}
@@ -0,0 +1,381 @@
+/*
+ lbfgs.go
+
+ Implementation of the limited-memory BFGS (L-BFGS) optimizer for regularized
+ least squares regression.
+
+ author: Timothy A. Mann
+ date: September 3, 2014
+*/
+
+package goml
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/gonum/floats"
+	"github.com/gonum/matrix/mat64"
+)
+
+/*
+LBFGS fits a LinearFunction by minimizing regularized squared error with
+limited-memory BFGS. It converges much faster than SGD on convex regularized
+objectives because it approximates the inverse Hessian from the last M
+gradient observations instead of following the raw gradient.
+*/
+type LBFGS struct {
+	/*
+		The penalty type to apply (L1_PENALTY or L2_PENALTY).
+	*/
+	PenaltyType int
+	/*
+		The regularization parameter.
+	*/
+	Lambda float64
+	/*
+		The number of L-BFGS iterations to run during fitting.
+	*/
+	NumIterations int
+	/*
+		The number of (s, y) correction pairs to retain when approximating
+		the inverse Hessian.
+	*/
+	M int
+
+	inputDims int
+	afunc     ActivationFunction
+	f         *LinearFunction
+
+	// Design matrix and targets captured by Fit and read by evaluate.
+	xb       *mat64.Dense
+	yb       *mat64.Dense
+	nSamples int
+
+	// Ring buffer of the last M correction pairs (s_k = w_{k+1}-w_k,
+	// y_k = g_{k+1}-g_k) and rho_k = 1/(s_k . y_k).
+	s      [][]float64
+	y      [][]float64
+	rho    []float64
+	oldest int
+	count  int
+}
+
+/*
+NewLBFGS constructs a new LBFGS instance.
+
+Input
+=====
+penaltyType : the type of regularization penalty to use during fitting (either L1_PENALTY or L2_PENALTY)
+lambda : the regularization parameter (should >= 0)
+numIterations : the number of L-BFGS iterations to run during fitting
+m : the number of correction pairs to remember (a typical value is between 5 and 20)
+afunc : an ActivationFunction applied to the output of the linear model, or nil for none
+
+Returns
+=======
+a pointer to a new (untrained) LBFGS instance or an error
+*/
+func NewLBFGS(penaltyType int, lambda float64, numIterations int, m int, afunc ActivationFunction) (*LBFGS, error) {
+	if penaltyType != L1_PENALTY && penaltyType != L2_PENALTY {
+		return nil, fmt.Errorf("Invalid regularization penalty type. Valid types are L1_PENALTY or L2_PENALTY.")
+	}
+	if lambda < 0.0 {
+		return nil, fmt.Errorf("Regularization parameter cannot be negative.")
+	}
+	if numIterations < 1 {
+		return nil, fmt.Errorf("numIterations must be positive.")
+	}
+	if m < 1 {
+		return nil, fmt.Errorf("m must be positive.")
+	}
+	self := new(LBFGS)
+	self.PenaltyType = penaltyType
+	self.Lambda = lambda
+	self.NumIterations = numIterations
+	self.M = m
+	self.afunc = afunc
+	return self, nil
+}
+
+func (self *LBFGS) Fit(x mat64.Matrix, y mat64.Matrix) error {
+	if rows(x) != rows(y) {
+		return fmt.Errorf("The number of rows in x (%d) does not match the number of rows in y (%d). The matrix x should contain one input vector per row and the vector y should be a column vector containing labels for each input vector.", rows(x), rows(y))
+	}
+	if cols(y) != 1 {
+		return fmt.Errorf("y must be a column vector.")
+	}
+
+	self.inputDims = cols(x)
+	self.nSamples = rows(x)
+	d := self.inputDims + 1
+
+	self.xb = mat64.NewDense(self.nSamples, d, nil)
+	for r := 0; r < self.nSamples; r++ {
+		for c := 0; c < self.inputDims; c++ {
+			self.xb.Set(r, c, x.At(r, c))
+		}
+		self.xb.Set(r, self.inputDims, 1)
+	}
+	self.yb = mat64.NewDense(self.nSamples, 1, nil)
+	for r := 0; r < self.nSamples; r++ {
+		self.yb.Set(r, 0, y.At(r, 0))
+	}
+
+	self.resetMemory(d)
+
+	w := make([]float64, d)
+	fval, g := self.evaluate(w)
+
+	for iter := 0; iter < self.NumIterations; iter++ {
+		dir := self.NextDirection(g)
+		alpha := self.lineSearch(w, dir, g, fval)
+
+		wNew := make([]float64, d)
+		copy(wNew, w)
+		floats.AddScaled(wNew, alpha, dir)
+		fNew, gNew := self.evaluate(wNew)
+
+		s := make([]float64, d)
+		copy(s, wNew)
+		floats.Sub(s, w)
+		yv := make([]float64, d)
+		copy(yv, gNew)
+		floats.Sub(yv, g)
+
+		sy := floats.Dot(s, yv)
+		if sy > 1e-10 {
+			self.push(s, yv, 1.0/sy)
+		}
+
+		w, g, fval = wNew, gNew, fNew
+	}
+
+	self.f = new(LinearFunction)
+	self.f.Weights = mat64.NewDense(d, 1, w)
+	self.f.AFunc = self.afunc
+	return nil
+}
+
+/*
+evaluate computes the regularized mean squared error of w on the training
+data captured by Fit along with its gradient.
+*/
+func (self *LBFGS) evaluate(w []float64) (float64, []float64) {
+	d := len(w)
+	wDense := mat64.NewDense(d, 1, w)
+
+	// z is the pre-activation output of the linear model; pred runs it
+	// through afunc (if any), matching what Predict/PredictM do at
+	// inference time.
+	var z, residual mat64.Dense
+	z.Mul(self.xb, wDense)
+	var pred mat64.Matrix = &z
+	if self.afunc != nil {
+		pred = Apply(&z, self.afunc.Eval)
+	}
+	residual.Sub(self.yb, pred)
+
+	n := float64(self.nSamples)
+	loss := 0.0
+	for _, r := range residual.RawMatrix().Data {
+		loss += r * r / (2 * n)
+	}
+
+	// The chain rule through afunc multiplies the residual by
+	// afunc.Deriv(z) element-wise before it is backpropagated into the
+	// weights.
+	if self.afunc != nil {
+		for i := 0; i < self.nSamples; i++ {
+			residual.Set(i, 0, residual.At(i, 0)*self.afunc.Deriv(z.At(i, 0)))
+		}
+	}
+
+	var gradM mat64.Dense
+	gradM.Mul(self.xb.T(), &residual)
+	grad := make([]float64, d)
+	gdata := gradM.RawMatrix().Data
+	for j := range grad {
+		grad[j] = -gdata[j] / n
+	}
+
+	if self.PenaltyType == L1_PENALTY {
+		for j, wj := range w {
+			loss += self.Lambda * math.Abs(wj)
+			grad[j] += self.Lambda * signum(wj)
+		}
+	} else {
+		for j, wj := range w {
+			loss += 0.5 * self.Lambda * wj * wj
+			grad[j] += self.Lambda * wj
+		}
+	}
+
+	return loss, grad
+}
+
+/*
+NextDirection computes a descent direction from the gradient g using the
+L-BFGS two-loop recursion over the stored (s, y, rho) correction pairs.
+*/
+func (self *LBFGS) NextDirection(g []float64) []float64 {
+	dir := make([]float64, len(g))
+	copy(dir, g)
+
+	a := make([]float64, self.M)
+	for i := 0; i < self.count; i++ {
+		idx := self.index(i)
+		a[idx] = self.rho[idx] * floats.Dot(self.s[idx], dir)
+		floats.AddScaled(dir, -a[idx], self.y[idx])
+	}
+
+	if self.count > 0 {
+		last := self.index(0)
+		num := floats.Dot(self.s[last], self.y[last])
+		den := floats.Dot(self.y[last], self.y[last])
+		if den != 0 {
+			scale := num / den
+			for i := range dir {
+				dir[i] *= scale
+			}
+		}
+	}
+
+	for i := self.count - 1; i >= 0; i-- {
+		idx := self.index(i)
+		beta := self.rho[idx] * floats.Dot(self.y[idx], dir)
+		floats.AddScaled(dir, a[idx]-beta, self.s[idx])
+	}
+
+	for i := range dir {
+		dir[i] = -dir[i]
+	}
+	return dir
+}
+
+/*
+lineSearch performs backtracking line search starting from alpha = 1,
+shrinking alpha when the Armijo (sufficient decrease) condition fails and
+growing it when the curvature condition fails, so that the returned step
+approximately satisfies the Wolfe conditions.
+*/
+func (self *LBFGS) lineSearch(w, dir, g []float64, f0 float64) float64 {
+	const c1 = 1e-4
+	const c2 = 0.9
+	const maxSteps = 50
+
+	dirDotG := floats.Dot(dir, g)
+	alpha := 1.0
+	wTry := make([]float64, len(w))
+	for iter := 0; iter < maxSteps; iter++ {
+		copy(wTry, w)
+		floats.AddScaled(wTry, alpha, dir)
+		fTry, gTry := self.evaluate(wTry)
+
+		if fTry > f0+c1*alpha*dirDotG {
+			alpha *= 0.5
+			continue
+		}
+		if floats.Dot(dir, gTry) < c2*dirDotG {
+			alpha *= 2.0
+			continue
+		}
+		break
+	}
+	return alpha
+}
+
+/*
+resetMemory (re)allocates the ring buffer used to store correction pairs for
+a problem of dimension d.
+*/
+func (self *LBFGS) resetMemory(d int) {
+	self.s = make([][]float64, self.M)
+	self.y = make([][]float64, self.M)
+	for i := 0; i < self.M; i++ {
+		self.s[i] = make([]float64, d)
+		self.y[i] = make([]float64, d)
+	}
+	self.rho = make([]float64, self.M)
+	self.oldest = 0
+	self.count = 0
+}
+
+/*
+index maps i, the i-th most recently stored correction pair (0 = most
+recent), to its physical slot in the ring buffer.
+*/
+func (self *LBFGS) index(i int) int {
+	return ((self.oldest-1-i)%self.M + self.M) % self.M
+}
+
+/*
+push stores a new correction pair, overwriting the oldest one once the
+buffer is full.
+*/
+func (self *LBFGS) push(s, y []float64, rho float64) {
+	copy(self.s[self.oldest], s)
+	copy(self.y[self.oldest], y)
+	self.rho[self.oldest] = rho
+	self.oldest = (self.oldest + 1) % self.M
+	if self.count < self.M {
+		self.count++
+	}
+}
+
+func (self LBFGS) addBiasToVector(x mat64.Matrix) *mat64.Dense {
+	xb := mat64.NewDense(1, self.InputDims()+1, nil)
+	for i := 0; i < self.InputDims(); i++ {
+		xb.Set(0, i, x.At(0, i))
+	}
+	xb.Set(0, self.InputDims(), 1)
+	return xb
+}
+
+func (self LBFGS) Predict(x mat64.Matrix) (float64, error) {
+	if self.f == nil {
+		return 0, fmt.Errorf("Cannot predict before running the Fit method.")
+	}
+	if cols(x) != self.InputDims() {
+		return 0, fmt.Errorf("x has %d columns. Expected %d.", cols(x), self.InputDims())
+	}
+	return self.f.Predict(self.addBiasToVector(x))
+}
+
+func (self LBFGS) PredictM(x mat64.Matrix) (mat64.Matrix, error) {
+	if self.f == nil {
+		return nil, fmt.Errorf("Cannot predict before running the Fit method.")
+	}
+	if cols(x) != self.InputDims() {
+		return nil, fmt.Errorf("x has %d columns. Expected %d.", cols(x), self.InputDims())
+	}
+	n := rows(x)
+	xb := mat64.NewDense(n, self.InputDims()+1, nil)
+	for r := 0; r < n; r++ {
+		for c := 0; c < self.InputDims(); c++ {
+			xb.Set(r, c, x.At(r, c))
+		}
+		xb.Set(r, self.InputDims(), 1)
+	}
+	return self.f.PredictM(xb)
+}
+
+func (self LBFGS) InputDims() int {
+	return self.inputDims
+}
+
+/*
+Weights returns the weight vector obtained during the fitting process. If
+Fit() has not been executed yet, then the behavior of this method is
+undefined.
+
+Returns
+=======
+a column vector of weights (including an additional weight for the bias)
+*/
+func (self LBFGS) Weights() *mat64.Dense {
+	if self.f != nil {
+		return self.f.Weights
+	}
+	return mat64.NewDense(1, 1, nil)
+}
@@ -0,0 +1,453 @@
+/*
+ network.go
+
+ A feed-forward neural network built out of Layers, trained with
+ backpropagation.
+
+ author: Timothy A. Mann
+ date: September 22, 2014
+*/
+
+package goml
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/gonum/matrix/mat64"
+)
+
+/*
+Optimizer applies a single gradient step to a parameter vector in place.
+Network keeps one Optimizer per weight matrix and one per bias vector so
+that optimizers with per-coordinate state (e.g. momentum) can be reused
+across calls to Step.
+*/
+type Optimizer interface {
+	/*
+		Step updates w in place given its gradient grad. w and grad must have
+		the same length.
+	*/
+	Step(w, grad []float64)
+
+	/*
+		SetRate updates the learning rate used by subsequent calls to Step.
+	*/
+	SetRate(rate float64)
+}
+
+/*
+GDOptimizer applies plain gradient descent: w -= Rate*grad.
+*/
+type GDOptimizer struct {
+	Rate float64
+}
+
+func (self *GDOptimizer) Step(w, grad []float64) {
+	for i := range w {
+		w[i] -= self.Rate * grad[i]
+	}
+}
+
+func (self *GDOptimizer) SetRate(rate float64) {
+	self.Rate = rate
+}
+
+/*
+MomentumOptimizer applies gradient descent with momentum: it accumulates an
+exponentially weighted velocity of past gradients and moves w by that
+velocity instead of the raw gradient, which damps oscillations and speeds up
+convergence along consistent directions.
+*/
+type MomentumOptimizer struct {
+	Rate     float64
+	Momentum float64
+
+	velocity []float64
+}
+
+func (self *MomentumOptimizer) Step(w, grad []float64) {
+	if len(self.velocity) != len(grad) {
+		self.velocity = make([]float64, len(grad))
+	}
+	for i := range self.velocity {
+		self.velocity[i] = self.Momentum*self.velocity[i] - self.Rate*grad[i]
+		w[i] += self.velocity[i]
+	}
+}
+
+func (self *MomentumOptimizer) SetRate(rate float64) {
+	self.Rate = rate
+}
+
+/*
+Layer is a single fully-connected layer of a Network: an affine map followed
+by an optional ActivationFunction.
+*/
+type Layer struct {
+	Weights *mat64.Dense
+	Bias    *mat64.Vector
+	AFunc   ActivationFunction
+
+	WOpt Optimizer
+	BOpt Optimizer
+}
+
+/*
+NewLayer constructs a new Layer whose weights are drawn from a normal
+distribution with standard deviation 0.1 and whose bias is zero. Random
+weights keep the units of a hidden layer from all computing, and being
+updated with, the same value.
+
+Input
+=====
+inputDims : the number of inputs to the layer
+outputDims : the number of units in the layer
+afunc : an ActivationFunction applied to the layer's output, or nil for none
+
+Returns
+=======
+a pointer to a new Layer
+*/
+func NewLayer(inputDims, outputDims int, afunc ActivationFunction) *Layer {
+	weights := make([]float64, inputDims*outputDims)
+	for i := range weights {
+		weights[i] = 0.1 * rand.NormFloat64()
+	}
+	return &Layer{
+		Weights: mat64.NewDense(inputDims, outputDims, weights),
+		Bias:    mat64.NewVector(outputDims, nil),
+		AFunc:   afunc,
+	}
+}
+
+/*
+LearningConfiguration holds the hyperparameters used by Network.Train.
+*/
+type LearningConfiguration struct {
+	/*
+		The number of passes over the training data.
+	*/
+	Epochs int
+	/*
+		The initial learning rate.
+	*/
+	Rate float64
+	/*
+		Controls how quickly the learning rate decays across epochs:
+		rate_e = Rate / (1 + Decay*e). A Decay of 0 keeps the rate constant.
+	*/
+	Decay float64
+	/*
+		The number of samples whose gradients are averaged before each
+		weight update. 0 or a value >= the number of training samples means
+		full-batch gradient descent.
+	*/
+	BatchSize int
+}
+
+/*
+Network is a feed-forward neural network composed of Layers, each of which
+may have its own ActivationFunction. It satisfies the Function and
+FunctionApproximator interfaces, so it can be used anywhere a LinearFunction
+or SGD could be.
+*/
+type Network struct {
+	Layers []*Layer
+
+	// input, preAct, and act are populated by Forward and consumed by
+	// Backward.
+	input  *mat64.Dense
+	preAct []*mat64.Dense
+	act    []*mat64.Dense
+}
+
+/*
+NewNetwork constructs a Network from the given Layers. The output dimension
+of layer i must match the input dimension of layer i+1.
+*/
+func NewNetwork(layers ...*Layer) *Network {
+	return &Network{Layers: layers}
+}
+
+func (self *Network) InputDims() int {
+	if len(self.Layers) == 0 {
+		return 0
+	}
+	r, _ := self.Layers[0].Weights.Dims()
+	return r
+}
+
+func (self *Network) outputDims() int {
+	if len(self.Layers) == 0 {
+		return 0
+	}
+	_, c := self.Layers[len(self.Layers)-1].Weights.Dims()
+	return c
+}
+
+/*
+Forward computes the network's output for a single input row, caching each
+layer's pre-activation (z = x*W + b) and activation (a = AFunc(z)) so that
+Backward can compute gradients via the chain rule.
+
+Input
+=====
+x : a single input row vector
+
+Returns
+=======
+the network's output row vector, or an error
+*/
+func (self *Network) Forward(x mat64.Matrix) (mat64.Matrix, error) {
+	if cols(x) != self.InputDims() {
+		return nil, fmt.Errorf("x has %d columns. Expected %d.", cols(x), self.InputDims())
+	}
+
+	self.input = mat64.DenseCopyOf(x)
+	self.preAct = make([]*mat64.Dense, len(self.Layers))
+	self.act = make([]*mat64.Dense, len(self.Layers))
+
+	a := mat64.Matrix(self.input)
+	for i, layer := range self.Layers {
+		var z mat64.Dense
+		z.Mul(a, layer.Weights)
+		_, outDim := z.Dims()
+		for j := 0; j < outDim; j++ {
+			z.Set(0, j, z.At(0, j)+layer.Bias.At(j, 0))
+		}
+		self.preAct[i] = &z
+
+		act := Apply(&z, activationEval(layer.AFunc)).(*mat64.Dense)
+		self.act[i] = act
+		a = act
+	}
+
+	return a, nil
+}
+
+/*
+Backward computes the gradient of the squared error (a - target)^2 with
+respect to every layer's weights and bias, where a is the network's output
+from the most recent call to Forward. The returned slices are indexed the
+same way as self.Layers.
+*/
+func (self *Network) Backward(target float64) ([]*mat64.Dense, []*mat64.Vector, error) {
+	if self.act == nil {
+		return nil, nil, fmt.Errorf("Forward must be called before Backward.")
+	}
+
+	numLayers := len(self.Layers)
+	gradsW := make([]*mat64.Dense, numLayers)
+	gradsB := make([]*mat64.Vector, numLayers)
+
+	outDim := self.outputDims()
+	delta := mat64.NewDense(1, outDim, nil)
+	lastLayer := self.Layers[numLayers-1]
+	for j := 0; j < outDim; j++ {
+		d := self.act[numLayers-1].At(0, j) - target
+		delta.Set(0, j, d*activationDeriv(lastLayer.AFunc, self.preAct[numLayers-1].At(0, j)))
+	}
+
+	for l := numLayers - 1; l >= 0; l-- {
+		layer := self.Layers[l]
+		var prevAct mat64.Matrix
+		if l == 0 {
+			prevAct = self.input
+		} else {
+			prevAct = self.act[l-1]
+		}
+
+		var dW mat64.Dense
+		dW.Mul(prevAct.T(), delta)
+		gradsW[l] = &dW
+
+		_, dOut := delta.Dims()
+		dB := mat64.NewVector(dOut, nil)
+		for j := 0; j < dOut; j++ {
+			dB.SetVec(j, delta.At(0, j))
+		}
+		gradsB[l] = dB
+
+		if l > 0 {
+			var deltaPrev mat64.Dense
+			deltaPrev.Mul(delta, layer.Weights.T())
+			prevLayer := self.Layers[l-1]
+			_, prevDim := deltaPrev.Dims()
+			for j := 0; j < prevDim; j++ {
+				dv := activationDeriv(prevLayer.AFunc, self.preAct[l-1].At(0, j))
+				deltaPrev.Set(0, j, deltaPrev.At(0, j)*dv)
+			}
+			delta = &deltaPrev
+		}
+	}
+
+	return gradsW, gradsB, nil
+}
+
+/*
+Update applies one gradient step to every layer using that layer's
+optimizer (WOpt for Weights, BOpt for Bias).
+*/
+func (self *Network) Update(gradsW []*mat64.Dense, gradsB []*mat64.Vector) {
+	for l, layer := range self.Layers {
+		layer.WOpt.Step(layer.Weights.RawMatrix().Data, gradsW[l].RawMatrix().Data)
+		layer.BOpt.Step(layer.Bias.RawVector().Data, gradsB[l].RawVector().Data)
+	}
+}
+
+/*
+Train fits the network to the training data using backpropagation,
+permuting the samples each epoch and averaging gradients over config.
+BatchSize samples between weight updates.
+*/
+func (self *Network) Train(x mat64.Matrix, y mat64.Matrix, config LearningConfiguration) error {
+	if rows(x) != rows(y) {
+		return fmt.Errorf("The number of rows in x (%d) does not match the number of rows in y (%d).", rows(x), rows(y))
+	}
+	if cols(y) != 1 {
+		return fmt.Errorf("y must be a column vector.")
+	}
+	if cols(x) != self.InputDims() {
+		return fmt.Errorf("x has %d columns. Expected %d.", cols(x), self.InputDims())
+	}
+
+	for _, layer := range self.Layers {
+		if layer.WOpt == nil {
+			layer.WOpt = &GDOptimizer{Rate: config.Rate}
+		}
+		if layer.BOpt == nil {
+			layer.BOpt = &GDOptimizer{Rate: config.Rate}
+		}
+	}
+
+	n := rows(x)
+	batchSize := config.BatchSize
+	if batchSize <= 0 || batchSize > n {
+		batchSize = n
+	}
+
+	for epoch := 0; epoch < config.Epochs; epoch++ {
+		rate := config.Rate / (1 + config.Decay*float64(epoch))
+		for _, layer := range self.Layers {
+			layer.WOpt.SetRate(rate)
+			layer.BOpt.SetRate(rate)
+		}
+
+		var accW []*mat64.Dense
+		var accB []*mat64.Vector
+		count := 0
+
+		for _, idx := range rand.Perm(n) {
+			row := rowOf(x, idx)
+			if _, err := self.Forward(row); err != nil {
+				return err
+			}
+			gradsW, gradsB, err := self.Backward(y.At(idx, 0))
+			if err != nil {
+				return err
+			}
+
+			if accW == nil {
+				accW, accB = gradsW, gradsB
+			} else {
+				for l := range accW {
+					accW[l].Add(accW[l], gradsW[l])
+					accB[l].AddVec(accB[l], gradsB[l])
+				}
+			}
+			count++
+
+			if count >= batchSize {
+				scaleGrads(accW, accB, 1.0/float64(count))
+				self.Update(accW, accB)
+				accW, accB, count = nil, nil, 0
+			}
+		}
+		if count > 0 {
+			scaleGrads(accW, accB, 1.0/float64(count))
+			self.Update(accW, accB)
+		}
+	}
+
+	return nil
+}
+
+/*
+Fit trains the network with a default LearningConfiguration so that Network
+satisfies the FunctionApproximator interface.
+*/
+func (self *Network) Fit(x mat64.Matrix, y mat64.Matrix) error {
+	return self.Train(x, y, LearningConfiguration{Epochs: 200, Rate: 0.1, Decay: 0.01, BatchSize: 1})
+}
+
+func (self *Network) Predict(x mat64.Matrix) (float64, error) {
+	a, err := self.Forward(x)
+	if err != nil {
+		return 0, err
+	}
+	return a.At(0, 0), nil
+}
+
+func (self *Network) PredictM(x mat64.Matrix) (mat64.Matrix, error) {
+	if cols(x) != self.InputDims() {
+		return nil, fmt.Errorf("x has %d columns. Expected %d.", cols(x), self.InputDims())
+	}
+	n := rows(x)
+	out := mat64.NewDense(n, self.outputDims(), nil)
+	for i := 0; i < n; i++ {
+		a, err := self.Forward(rowOf(x, i))
+		if err != nil {
+			return nil, err
+		}
+		_, outDim := a.Dims()
+		for j := 0; j < outDim; j++ {
+			out.Set(i, j, a.At(0, j))
+		}
+	}
+	return out, nil
+}
+
+/*
+activationEval returns afunc.Eval, or nil if afunc is nil, so that it can be
+passed directly to Apply.
+*/
+func activationEval(afunc ActivationFunction) SFunction {
+	if afunc == nil {
+		return nil
+	}
+	return afunc.Eval
+}
+
+/*
+activationDeriv returns afunc.Deriv(z), or 1 (the derivative of the
+identity) if afunc is nil.
+*/
+func activationDeriv(afunc ActivationFunction, z float64) float64 {
+	if afunc == nil {
+		return 1
+	}
+	return afunc.Deriv(z)
+}
+
+/*
+rowOf extracts row i of x as a standalone 1-row matrix.
+*/
+func rowOf(x mat64.Matrix, i int) *mat64.Dense {
+	_, c := x.Dims()
+	row := mat64.NewDense(1, c, nil)
+	for j := 0; j < c; j++ {
+		row.Set(0, j, x.At(i, j))
+	}
+	return row
+}
+
+/*
+scaleGrads scales every weight and bias gradient in place by alpha.
+*/
+func scaleGrads(gradsW []*mat64.Dense, gradsB []*mat64.Vector, alpha float64) {
+	for l := range gradsW {
+		gradsW[l].Scale(alpha, gradsW[l])
+		gradsB[l].ScaleVec(alpha, gradsB[l])
+	}
+}
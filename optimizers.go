@@ -0,0 +1,131 @@
+/*
+ optimizers.go
+
+ Adaptive per-coordinate Optimizers, built on the Optimizer interface defined
+ in network.go.
+
+ author: Timothy A. Mann
+ date: October 6, 2014
+*/
+
+package goml
+
+import (
+	"math"
+)
+
+/*
+InverseTimeOptimizer applies gradient descent with a learning rate that decays
+as the inverse of the number of steps taken so far:
+rate_t = Rate / (1 + Decay*t).
+*/
+type InverseTimeOptimizer struct {
+	Rate  float64
+	Decay float64
+
+	t int
+}
+
+func (self *InverseTimeOptimizer) Step(w, grad []float64) {
+	rate := self.Rate / (1 + self.Decay*float64(self.t))
+	for i := range w {
+		w[i] -= rate * grad[i]
+	}
+	self.t++
+}
+
+func (self *InverseTimeOptimizer) SetRate(rate float64) {
+	self.Rate = rate
+}
+
+/*
+AdaGradOptimizer applies gradient descent with a per-coordinate learning rate
+that shrinks monotonically with the sum of squared gradients seen so far on
+that coordinate, so that infrequently updated coordinates keep a larger
+effective rate than frequently updated ones.
+*/
+type AdaGradOptimizer struct {
+	Rate    float64
+	Epsilon float64
+
+	accum []float64
+}
+
+func (self *AdaGradOptimizer) Step(w, grad []float64) {
+	if len(self.accum) != len(grad) {
+		self.accum = make([]float64, len(grad))
+	}
+	for i := range w {
+		self.accum[i] += grad[i] * grad[i]
+		w[i] -= self.Rate / math.Sqrt(self.accum[i]+self.Epsilon) * grad[i]
+	}
+}
+
+func (self *AdaGradOptimizer) SetRate(rate float64) {
+	self.Rate = rate
+}
+
+/*
+RMSPropOptimizer applies gradient descent with a per-coordinate learning rate
+scaled by an exponential moving average of squared gradients, which (unlike
+AdaGradOptimizer) lets the effective rate grow back if a coordinate's
+gradients shrink.
+*/
+type RMSPropOptimizer struct {
+	Rate    float64
+	Decay   float64
+	Epsilon float64
+
+	accum []float64
+}
+
+func (self *RMSPropOptimizer) Step(w, grad []float64) {
+	if len(self.accum) != len(grad) {
+		self.accum = make([]float64, len(grad))
+	}
+	for i := range w {
+		self.accum[i] = self.Decay*self.accum[i] + (1-self.Decay)*grad[i]*grad[i]
+		w[i] -= self.Rate / math.Sqrt(self.accum[i]+self.Epsilon) * grad[i]
+	}
+}
+
+func (self *RMSPropOptimizer) SetRate(rate float64) {
+	self.Rate = rate
+}
+
+/*
+AdamOptimizer applies gradient descent using bias-corrected exponential moving
+averages of the gradient (first moment) and squared gradient (second moment)
+to set a per-coordinate learning rate, following Kingma & Ba (2014).
+*/
+type AdamOptimizer struct {
+	Rate    float64
+	Beta1   float64
+	Beta2   float64
+	Epsilon float64
+
+	m []float64
+	v []float64
+	t int
+}
+
+func (self *AdamOptimizer) Step(w, grad []float64) {
+	if len(self.m) != len(grad) {
+		self.m = make([]float64, len(grad))
+		self.v = make([]float64, len(grad))
+	}
+	self.t++
+	b1t := 1 - math.Pow(self.Beta1, float64(self.t))
+	b2t := 1 - math.Pow(self.Beta2, float64(self.t))
+	for i := range w {
+		self.m[i] = self.Beta1*self.m[i] + (1-self.Beta1)*grad[i]
+		self.v[i] = self.Beta2*self.v[i] + (1-self.Beta2)*grad[i]*grad[i]
+		mhat := self.m[i] / b1t
+		vhat := self.v[i] / b2t
+		w[i] -= self.Rate * mhat / (math.Sqrt(vhat) + self.Epsilon)
+	}
+}
+
+func (self *AdamOptimizer) SetRate(rate float64) {
+	self.Rate = rate
+}
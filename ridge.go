@@ -0,0 +1,222 @@
+/*
+ ridge.go
+
+ Closed-form L2-penalized (ridge) linear regression via SVD.
+
+ author: Timothy A. Mann
+ date: September 8, 2014
+*/
+
+package goml
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/gonum/matrix"
+	"github.com/gonum/matrix/mat64"
+)
+
+/*
+Ridge fits a linear model by solving L2-penalized least squares in closed
+form using the SVD of the (standardized) design matrix. Unlike SGD and
+LBFGS, Ridge has no learning rate to tune and produces the exact regularized
+least squares optimum in a single pass.
+*/
+type Ridge struct {
+	/*
+		The regularization parameter.
+	*/
+	Lambda float64
+
+	inputDims int
+
+	// Column means and standard deviations of the training data, used to
+	// standardize new instances the same way the training data was
+	// standardized, so that they can be multiplied by the fitted
+	// coefficients in beta.
+	means []float64
+	stds  []float64
+	yMean float64
+
+	// beta holds the fitted coefficients in standardized units.
+	beta *mat64.Dense
+
+	fitted    *mat64.Dense
+	residuals *mat64.Dense
+}
+
+/*
+NewRidge constructs a new Ridge instance.
+
+Input
+=====
+lambda : the regularization parameter (should >= 0)
+
+Returns
+=======
+a pointer to a new (untrained) Ridge instance or an error
+*/
+func NewRidge(lambda float64) (*Ridge, error) {
+	if lambda < 0.0 {
+		return nil, fmt.Errorf("Regularization parameter cannot be negative.")
+	}
+	self := new(Ridge)
+	self.Lambda = lambda
+	return self, nil
+}
+
+func (self *Ridge) Fit(x mat64.Matrix, y mat64.Matrix) error {
+	if rows(x) != rows(y) {
+		return fmt.Errorf("The number of rows in x (%d) does not match the number of rows in y (%d). The matrix x should contain one input vector per row and the vector y should be a column vector containing labels for each input vector.", rows(x), rows(y))
+	}
+	if cols(y) != 1 {
+		return fmt.Errorf("y must be a column vector.")
+	}
+
+	n := rows(x)
+	d := cols(x)
+	self.inputDims = d
+
+	self.means, self.stds = columnMeansAndStds(x)
+
+	self.yMean = 0.0
+	for i := 0; i < n; i++ {
+		self.yMean += y.At(i, 0)
+	}
+	self.yMean /= float64(n)
+
+	xs := mat64.NewDense(n, d, nil)
+	ys := mat64.NewDense(n, 1, nil)
+	for i := 0; i < n; i++ {
+		for j := 0; j < d; j++ {
+			xs.Set(i, j, (x.At(i, j)-self.means[j])/self.stds[j])
+		}
+		ys.Set(i, 0, y.At(i, 0)-self.yMean)
+	}
+
+	var svd mat64.SVD
+	if !svd.Factorize(xs, matrix.SVDThin) {
+		return fmt.Errorf("Failed to compute the SVD of the design matrix.")
+	}
+	var u, v mat64.Dense
+	u.UFromSVD(&svd)
+	v.VFromSVD(&svd)
+	s := svd.Values(nil)
+
+	var uty mat64.Dense
+	uty.Mul(u.T(), ys)
+
+	k := len(s)
+	coef := mat64.NewDense(k, 1, nil)
+	for i := 0; i < k; i++ {
+		coef.Set(i, 0, s[i]/(s[i]*s[i]+self.Lambda)*uty.At(i, 0))
+	}
+
+	self.beta = mat64.NewDense(d, 1, nil)
+	self.beta.Mul(&v, coef)
+
+	var pred mat64.Dense
+	pred.Mul(xs, self.beta)
+	self.fitted = mat64.NewDense(n, 1, nil)
+	self.residuals = mat64.NewDense(n, 1, nil)
+	for i := 0; i < n; i++ {
+		fit := self.yMean + pred.At(i, 0)
+		self.fitted.Set(i, 0, fit)
+		self.residuals.Set(i, 0, y.At(i, 0)-fit)
+	}
+
+	return nil
+}
+
+func (self Ridge) Predict(x mat64.Matrix) (float64, error) {
+	if self.beta == nil {
+		return 0, fmt.Errorf("Cannot predict before running the Fit method.")
+	}
+	if cols(x) != self.inputDims {
+		return 0, fmt.Errorf("x has %d columns. Expected %d.", cols(x), self.inputDims)
+	}
+	yhat := self.yMean
+	for j := 0; j < self.inputDims; j++ {
+		yhat += self.beta.At(j, 0) * (x.At(0, j) - self.means[j]) / self.stds[j]
+	}
+	return yhat, nil
+}
+
+func (self Ridge) PredictM(x mat64.Matrix) (mat64.Matrix, error) {
+	if self.beta == nil {
+		return nil, fmt.Errorf("Cannot predict before running the Fit method.")
+	}
+	if cols(x) != self.inputDims {
+		return nil, fmt.Errorf("x has %d columns. Expected %d.", cols(x), self.inputDims)
+	}
+	n := rows(x)
+	yhat := mat64.NewDense(n, 1, nil)
+	for i := 0; i < n; i++ {
+		v := self.yMean
+		for j := 0; j < self.inputDims; j++ {
+			v += self.beta.At(j, 0) * (x.At(i, j) - self.means[j]) / self.stds[j]
+		}
+		yhat.Set(i, 0, v)
+	}
+	return yhat, nil
+}
+
+func (self Ridge) InputDims() int {
+	return self.inputDims
+}
+
+/*
+Residuals returns y - yhat for the training data passed to Fit.
+
+Returns
+=======
+a column vector of residuals, one per training sample
+*/
+func (self Ridge) Residuals() *mat64.Dense {
+	return self.residuals
+}
+
+/*
+Fitted returns the fitted values (predictions on the training data) computed
+during Fit.
+
+Returns
+=======
+a column vector of fitted values, one per training sample
+*/
+func (self Ridge) Fitted() *mat64.Dense {
+	return self.fitted
+}
+
+/*
+columnMeansAndStds computes the mean and (population) standard deviation of
+each column of x. Columns with zero variance get a standard deviation of 1
+so that standardization only centers them instead of dividing by zero.
+*/
+func columnMeansAndStds(x mat64.Matrix) ([]float64, []float64) {
+	n := rows(x)
+	d := cols(x)
+	means := make([]float64, d)
+	stds := make([]float64, d)
+	for j := 0; j < d; j++ {
+		sum := 0.0
+		for i := 0; i < n; i++ {
+			sum += x.At(i, j)
+		}
+		means[j] = sum / float64(n)
+	}
+	for j := 0; j < d; j++ {
+		ss := 0.0
+		for i := 0; i < n; i++ {
+			diff := x.At(i, j) - means[j]
+			ss += diff * diff
+		}
+		std := math.Sqrt(ss / float64(n))
+		if std == 0 {
+			std = 1
+		}
+		stds[j] = std
+	}
+	return means, stds
+}
@@ -11,8 +11,10 @@ package goml
 
 import (
 	"fmt"
-	mat "github.com/skelterjohn/go.matrix"
 	"math/rand"
+
+	"github.com/gonum/floats"
+	"github.com/gonum/matrix/mat64"
 )
 
 const (
@@ -41,11 +43,36 @@ type SGD struct {
 	*/
 	LearningRate float64
 
+	/*
+		The number of samples used to estimate the gradient on each iteration.
+		0 means use the full training set (batch gradient descent), 1 gives
+		the classic pure-SGD update, and any other k smaller than the number
+		of training samples draws a mini-batch of that size (with
+		replacement) on each iteration. A negative k, or a k of at least the
+		number of training samples, is treated like 0.
+	*/
+	BatchSize int
+
+	/*
+		The Optimizer used to turn a gradient into a weight update. If nil,
+		Fit defaults to plain gradient descent with a constant learning rate
+		of LearningRate/InputDims(), as before BatchSize and Optimizer were
+		introduced. Set this to an AdaGradOptimizer, RMSPropOptimizer,
+		AdamOptimizer, or InverseTimeOptimizer for an adaptive or decaying
+		per-coordinate learning rate.
+	*/
+	Optimizer Optimizer
+
 	/*
 		The number of dimensions of a valid input vector.
 	*/
 	inputDims int
 
+	/*
+		The activation function applied to the linear model, if any.
+	*/
+	afunc ActivationFunction
+
 	/*
 		A LinearFunction.
 	*/
@@ -59,14 +86,19 @@ Input
 =====
 penaltyType : the type of regularization penalty to user during fitting (either L1_PENALTY or L2_PENALTY)
 lambda : the regularization parameter (should >= 0)
-numIterations : the number of iterations to run during fitting. One iteration corresponds to updating with a single sample.
+numIterations : the number of iterations to run during fitting. Each iteration updates the weights once from the gradient estimated over a batch of BatchSize samples (BatchSize 1, the default, gives the classic per-sample update).
 learningRate : the constant learning rate parameter to use during training
+afunc : an ActivationFunction applied to the output of the linear model, or nil for none
+
+The returned instance defaults to BatchSize 1 (pure per-sample SGD); set
+BatchSize on the returned instance to switch to mini-batch or full-batch
+gradient descent.
 
 Returns
 =======
 a pointer to a new (untrained) SGD instance or an error
 */
-func NewSGD(penaltyType int, lambda float64, numIterations int, learningRate float64) (*SGD, error) {
+func NewSGD(penaltyType int, lambda float64, numIterations int, learningRate float64, afunc ActivationFunction) (*SGD, error) {
 	var f *SGD = new(SGD)
 	if penaltyType != L1_PENALTY && penaltyType != L2_PENALTY {
 		return nil, fmt.Errorf("Invalid regularization penalty type. Valid types are L1_PENALTY or L2_PENALTY.")
@@ -81,6 +113,8 @@ func NewSGD(penaltyType int, lambda float64, numIterations int, learningRate flo
 	}
 	f.NumIterations = numIterations
 	f.LearningRate = learningRate
+	f.afunc = afunc
+	f.BatchSize = 1
 
 	f.inputDims = 0
 	f.f = nil
@@ -97,83 +131,150 @@ Returns
 a new instance of *SGD with the same parameters as this instance
 */
 func (self *SGD) NewCopy() (*SGD, error) {
-	return NewSGD(self.PenaltyType, self.Lambda, self.NumIterations, self.LearningRate)
+	cp, err := NewSGD(self.PenaltyType, self.Lambda, self.NumIterations, self.LearningRate, self.afunc)
+	if err != nil {
+		return nil, err
+	}
+	cp.BatchSize = self.BatchSize
+	cp.Optimizer = self.Optimizer
+	return cp, nil
+}
+
+/*
+defaultOptimizer returns the Optimizer used by Fit when self.Optimizer is nil:
+plain gradient descent with a constant learning rate of
+LearningRate/inputDims, matching the behavior of SGD before Optimizer was
+introduced.
+*/
+func (self *SGD) defaultOptimizer() Optimizer {
+	return &GDOptimizer{Rate: self.LearningRate / float64(self.inputDims)}
 }
 
-func (self *SGD) Fit(x mat.MatrixRO, y mat.MatrixRO) error {
-	if x.Rows() != y.Rows() {
-		return fmt.Errorf("The number of rows in x (%d) does not match the number of rows in y (%d). The matrix x should contain one input vector per row and the vector y should be a column vector containing labels for each input vector.", x.Rows(), y.Rows())
+func (self *SGD) Fit(x mat64.Matrix, y mat64.Matrix) error {
+	if rows(x) != rows(y) {
+		return fmt.Errorf("The number of rows in x (%d) does not match the number of rows in y (%d). The matrix x should contain one input vector per row and the vector y should be a column vector containing labels for each input vector.", rows(x), rows(y))
 	}
-	if y.Cols() != 1 {
+	if cols(y) != 1 {
 		return fmt.Errorf("y must be a column vector.")
 	}
 
 	// The number of samples in the data set
-	n := x.Rows()
-	// Get a dense version of the input matrix
-	dx := x.DenseMatrix()
+	n := rows(x)
 
 	if self.f == nil {
-		self.inputDims = x.Cols()
+		self.inputDims = cols(x)
 		self.f = new(LinearFunction)
-		self.f.Weights = *mat.Zeros(self.inputDims+1, 1)
-	} else if self.inputDims != x.Cols() {
+		self.f.Weights = mat64.NewDense(self.inputDims+1, 1, nil)
+		self.f.AFunc = self.afunc
+	} else if self.inputDims != cols(x) {
 		return fmt.Errorf("The number of columns in matrix x does not match the dimension of previous training data. Please construct a new SGD instance.")
 	}
 
+	// m is the number of samples used to estimate the gradient on each
+	// iteration: the full training set, a mini-batch, or (the BatchSize == 1
+	// default) a single sample as in classic SGD.
+	m := self.BatchSize
+	if m <= 0 || m > n {
+		m = n
+	}
+	full := m == n
+
+	// w aliases the weight matrix's backing slice so the update below can
+	// lean on gonum/floats instead of looping over Get/Set element-by-element.
+	w := self.f.Weights.RawMatrix().Data
+	xb := mat64.NewDense(m, self.inputDims+1, nil)
+	yb := mat64.NewDense(m, 1, nil)
+	var z, residual, gradM mat64.Dense
+	grad := make([]float64, self.inputDims+1)
+
+	opt := self.Optimizer
+	if opt == nil {
+		opt = self.defaultOptimizer()
+	}
+
 	for i := 0; i < self.NumIterations; i++ {
-		index := rand.Intn(n)
-		xrow := dx.GetRowVector(index)
-		xrowb := self.addBiasToVector(xrow)
-		yhat, err := self.f.Predict(xrowb)
-		if err != nil {
-			return fmt.Errorf("Error while predicting with internal linear model. %v", err)
+		self.fillBatch(xb, yb, x, y, full)
+
+		// z is the pre-activation output of the linear model; pred runs it
+		// through afunc (if any), matching what Predict/PredictM do at
+		// inference time.
+		z.Mul(xb, self.f.Weights)
+		var pred mat64.Matrix = &z
+		if self.afunc != nil {
+			pred = Apply(&z, self.afunc.Eval)
 		}
+		residual.Sub(yb, pred)
 
-		diff := y.Get(index, 0) - yhat
-		for j := 0; j < self.inputDims+1; j++ {
-			// Get the old weight value
-			oldw := self.f.Weights.Get(j, 0)
-			// Calculate the gradient of the squared error
-			grad := 0.0
-			if j < self.inputDims {
-				grad = (diff * -xrow.Get(0, j))
-			} else {
-				// Gradient for the bias
-				grad = -diff
+		// The chain rule through afunc multiplies the residual by
+		// afunc.Deriv(z) element-wise before it is backpropagated into the
+		// weights.
+		if self.afunc != nil {
+			for r := 0; r < m; r++ {
+				residual.Set(r, 0, residual.At(r, 0)*self.afunc.Deriv(z.At(r, 0)))
 			}
+		}
+
+		// grad = -(Xb^T * residual) / m, the gradient of the mean squared
+		// error of the batch with respect to the weights (bias included as
+		// the last column of xb).
+		gradM.Mul(xb.T(), &residual)
+		copy(grad, gradM.RawMatrix().Data)
+		fm := float64(m)
+		for j := range grad {
+			grad[j] = -grad[j] / fm
+		}
 
-			// Calculate the gradient of the regularization penalty
-			gpen := 0.0
-			if self.PenaltyType == L1_PENALTY {
-				gpen = self.Lambda * signum(oldw)
-			} else {
-				gpen = self.Lambda * oldw
+		// Add the gradient of the regularization penalty.
+		if self.PenaltyType == L1_PENALTY {
+			for j, wj := range w {
+				grad[j] += self.Lambda * signum(wj)
 			}
-			// Calculate the change in weight
-			alpha := self.LearningRate / float64(self.inputDims)
-			deltaw := alpha * (grad + gpen)
-			neww := oldw - deltaw
-			// Set the new weight
-			self.f.Weights.Set(j, 0, neww)
+		} else {
+			floats.AddScaled(grad, self.Lambda, w)
 		}
+
+		opt.Step(w, grad)
 	}
 
 	return nil
 }
 
-func (self SGD) addBiasToVector(x mat.MatrixRO) *mat.DenseMatrix {
-	xb := mat.Ones(1, self.InputDims()+1)
+/*
+fillBatch fills xb and yb with a batch of training samples drawn from x and
+y: every sample in order when full is true, or len(xb)'s worth of samples
+drawn uniformly at random (with replacement) otherwise. Each row of xb has a
+constant 1 appended so that it can be multiplied directly against a weight
+vector that includes a bias term.
+*/
+func (self SGD) fillBatch(xb, yb *mat64.Dense, x, y mat64.Matrix, full bool) {
+	m, _ := xb.Dims()
+	n := rows(x)
+	for r := 0; r < m; r++ {
+		index := r
+		if !full {
+			index = rand.Intn(n)
+		}
+		for j := 0; j < self.inputDims; j++ {
+			xb.Set(r, j, x.At(index, j))
+		}
+		xb.Set(r, self.inputDims, 1)
+		yb.Set(r, 0, y.At(index, 0))
+	}
+}
+
+func (self SGD) addBiasToVector(x mat64.Matrix) *mat64.Dense {
+	xb := mat64.NewDense(1, self.InputDims()+1, nil)
 	for i := 0; i < self.InputDims(); i++ {
-		xb.Set(0, i, x.Get(0, i))
+		xb.Set(0, i, x.At(0, i))
 	}
+	xb.Set(0, self.InputDims(), 1)
 	return xb
 }
 
-func (self SGD) Predict(x mat.MatrixRO) (float64, error) {
+func (self SGD) Predict(x mat64.Matrix) (float64, error) {
 	if self.f != nil {
-		if x.Cols() != self.InputDims() {
-			return 0, fmt.Errorf("x has %d columns. Expected %d.", x.Cols(), self.InputDims())
+		if cols(x) != self.InputDims() {
+			return 0, fmt.Errorf("x has %d columns. Expected %d.", cols(x), self.InputDims())
 		}
 		// Add a bias to the input vector
 		xb := self.addBiasToVector(x)
@@ -184,6 +285,24 @@ func (self SGD) Predict(x mat.MatrixRO) (float64, error) {
 	}
 }
 
+func (self SGD) PredictM(x mat64.Matrix) (mat64.Matrix, error) {
+	if self.f == nil {
+		return nil, fmt.Errorf("Cannot predict before running the Fit method.")
+	}
+	if cols(x) != self.InputDims() {
+		return nil, fmt.Errorf("x has %d columns. Expected %d.", cols(x), self.InputDims())
+	}
+	n := rows(x)
+	xb := mat64.NewDense(n, self.InputDims()+1, nil)
+	for r := 0; r < n; r++ {
+		for c := 0; c < self.InputDims(); c++ {
+			xb.Set(r, c, x.At(r, c))
+		}
+		xb.Set(r, self.InputDims(), 1)
+	}
+	return self.f.PredictM(xb)
+}
+
 func (self SGD) InputDims() int {
 	return self.inputDims
 }
@@ -196,11 +315,11 @@ Returns
 =======
 a column vector of weights (including an additional weight for the bias)
 */
-func (self SGD) Weights() mat.DenseMatrix {
+func (self SGD) Weights() *mat64.Dense {
 	if self.f != nil {
 		return self.f.Weights
 	} else {
-		return *mat.Zeros(1, 1)
+		return mat64.NewDense(1, 1, nil)
 	}
 }
 